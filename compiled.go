@@ -0,0 +1,119 @@
+//go:build jantar_precompiled
+
+package jantar
+
+import (
+	"html/template"
+	"reflect"
+	"sync"
+)
+
+// compiledRoot accumulates every template baked in by tmplgen-generated
+// tmpl_<name>.go files. Each such file calls RegisterCompiledTemplate from
+// its init(); those run in file-name order, and tmplgen's file names are
+// derived from the template names alone, so the tree built here is
+// deterministic across builds.
+var compiledRoot *template.Template
+
+// RegisterCompiledTemplate adds a precompiled template to the process-wide
+// compiled tree. It's called from the init() functions tmplgen generates -
+// application code should not need to call it directly.
+func RegisterCompiledTemplate(name, src string, funcs template.FuncMap) {
+	var err error
+
+	if compiledRoot == nil {
+		compiledRoot, err = template.New(name).Funcs(funcs).Parse(src)
+	} else {
+		_, err = compiledRoot.New(name).Parse(src)
+	}
+
+	if err != nil {
+		panic("jantar: precompiled template '" + name + "' failed to parse: " + err.Error())
+	}
+}
+
+var (
+	compiledFuncMu  sync.RWMutex
+	compiledFuncs   template.FuncMap
+	compiledProxies template.FuncMap
+)
+
+func init() {
+	compiledFuncs = DefaultTmplFuncs()
+
+	// "livereload", "T" and "plural" are normally added to a running
+	// TemplateManager ad hoc - newTemplateManager's closure and
+	// I18n.Register - once it and its dependent modules exist. Neither has
+	// run yet when a tmplgen init() parses the compiled tree, so seed
+	// harmless placeholders here; RegisterCompiledFunc lets a project swap
+	// in the real implementation later, same as AddTmplFunc does for a
+	// live TemplateManager.
+	compiledFuncs["livereload"] = func() template.HTML { return template.HTML("") }
+	compiledFuncs["T"] = func(key string, args ...interface{}) string { return key }
+	compiledFuncs["plural"] = func(key string, n int, args ...interface{}) string { return key }
+}
+
+// RegisterCompiledFunc adds or replaces a template function available to
+// every precompiled template - the jantar_precompiled counterpart to
+// TemplateManager.AddTmplFunc. CompiledTmplFuncs hands tmplgen-generated
+// init()s a stable proxy for each name (see funcproxy.go, makeProxy), so
+// calling this after RegisterCompiledTemplate has already parsed the tree -
+// e.g. once a project wires up EnableLiveReload or I18n.Register against
+// the TemplateManager LoadCompiledTemplates populated - still takes effect
+// without re-parsing. Registering a brand new name has no effect: the
+// engine only proxies names CompiledTmplFuncs already knew about at parse
+// time.
+func RegisterCompiledFunc(name string, fn interface{}) {
+	compiledFuncMu.Lock()
+	defer compiledFuncMu.Unlock()
+	compiledFuncs[name] = fn
+}
+
+func resolveCompiledFunc(name string) (interface{}, bool) {
+	compiledFuncMu.RLock()
+	defer compiledFuncMu.RUnlock()
+
+	fn, ok := compiledFuncs[name]
+	return fn, ok
+}
+
+// CompiledTmplFuncs returns the FuncMap tmplgen-generated init() functions
+// should parse templates against: DefaultTmplFuncs plus "livereload", "T"
+// and "plural". Every entry is a stable proxy over RegisterCompiledFunc
+// rather than a value bound at generation time, so a project can supply the
+// real implementation any time before serving requests - see
+// RegisterCompiledFunc.
+func CompiledTmplFuncs() template.FuncMap {
+	compiledFuncMu.Lock()
+	defer compiledFuncMu.Unlock()
+
+	if compiledProxies == nil {
+		compiledProxies = make(template.FuncMap, len(compiledFuncs))
+	}
+
+	for name, fn := range compiledFuncs {
+		if _, ok := compiledProxies[name]; !ok {
+			compiledProxies[name] = makeProxy(name, reflect.TypeOf(fn), resolveCompiledFunc)
+		}
+	}
+
+	return compiledProxies
+}
+
+// LoadCompiledTemplates populates tm with the templates tmplgen baked in at
+// build time, without touching the filesystem. It's the jantar_precompiled
+// counterpart to loadTemplates, meant for production builds that ship as a
+// single binary with no template directory alongside them.
+//
+// Templates loaded this way were parsed once, at init() time, against
+// CompiledTmplFuncs - use RegisterCompiledFunc, not AddTmplFunc, to wire in
+// a real "livereload"/"T"/"plural" implementation or any other name
+// tmplgen's generated code parsed against; a name CompiledTmplFuncs didn't
+// know about at generation time can't be added later.
+func LoadCompiledTemplates(tm *TemplateManager) error {
+	tm.engineMu.Lock()
+	tm.engine = wrapHTMLEngine(compiledRoot)
+	tm.engineMu.Unlock()
+	tm.setDevError(nil)
+	return nil
+}
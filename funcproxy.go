@@ -0,0 +1,24 @@
+package jantar
+
+import (
+	"fmt"
+	"reflect"
+)
+
+// makeProxy builds a function value with the same signature as sig (the
+// type of an entry in tm.tmplFuncs) that, when called, looks up the current
+// implementation via resolve and forwards the call to it. The returned
+// value's identity never changes, which lets it be baked into a parsed
+// template once while the function it dispatches to is swapped out later.
+func makeProxy(name string, sig reflect.Type, resolve func(string) (interface{}, bool)) interface{} {
+	proxy := reflect.MakeFunc(sig, func(args []reflect.Value) []reflect.Value {
+		fn, ok := resolve(name)
+		if !ok {
+			panic(fmt.Sprintf("jantar: template func '%s' has no implementation", name))
+		}
+
+		return reflect.ValueOf(fn).Call(args)
+	})
+
+	return proxy.Interface()
+}
@@ -0,0 +1,43 @@
+package jantar
+
+import (
+	"reflect"
+	"testing"
+)
+
+func TestMakeProxyDispatchesToCurrentImplementation(t *testing.T) {
+	impl := func(s string) string { return "v1:" + s }
+
+	resolve := func(name string) (interface{}, bool) {
+		if name != "greet" {
+			return nil, false
+		}
+		return impl, true
+	}
+
+	proxy := makeProxy("greet", reflect.TypeOf(impl), resolve).(func(string) string)
+
+	if got := proxy("a"); got != "v1:a" {
+		t.Fatalf("proxy(%q) = %q, want %q", "a", got, "v1:a")
+	}
+
+	// Swap the implementation without rebuilding the proxy - this is the
+	// whole point of the indirection: a template already parsed against
+	// the proxy picks up the new behavior on its next call.
+	impl = func(s string) string { return "v2:" + s }
+	if got := proxy("a"); got != "v2:a" {
+		t.Fatalf("proxy(%q) after swap = %q, want %q", "a", got, "v2:a")
+	}
+}
+
+func TestMakeProxyPanicsOnUnresolvedName(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic for an unresolved proxy name")
+		}
+	}()
+
+	resolve := func(name string) (interface{}, bool) { return nil, false }
+	proxy := makeProxy("missing", reflect.TypeOf(func() {}), resolve).(func())
+	proxy()
+}
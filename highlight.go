@@ -0,0 +1,149 @@
+package jantar
+
+import (
+	"bytes"
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"os/exec"
+	"strings"
+	"sync"
+	"sync/atomic"
+
+	"github.com/alecthomas/chroma/v2"
+	chromahtml "github.com/alecthomas/chroma/v2/formatters/html"
+	"github.com/alecthomas/chroma/v2/lexers"
+	"github.com/alecthomas/chroma/v2/styles"
+)
+
+// highlightCache memoizes rendered code blocks by sha1(lexer, options, code)
+// so the same snippet isn't re-highlighted on every render of a template
+// that includes it. It's capped at highlightCacheLimit entries: fine for a
+// handful of doc pages, but nothing stops the code/options that key it from
+// having high cardinality, and sync.Map has no eviction of its own. Once the
+// cap is hit the whole cache is dropped and rebuilt from scratch rather than
+// tracking per-entry age - simple, and good enough since a cold cache just
+// re-populates its hot entries on the next few renders.
+var highlightCache sync.Map // map[string]template.HTML
+
+// highlightCacheSize is an approximate count of entries in highlightCache,
+// maintained alongside it since sync.Map doesn't expose a Len.
+var highlightCacheSize int64
+
+// highlightCacheLimit is the number of entries highlightCache is allowed to
+// hold before it's cleared.
+const highlightCacheLimit = 2048
+
+// PygmentizePath, if set, is used as a fallback for languages Chroma (a
+// pure-Go highlighter) doesn't know, and when Chroma fails to render. It's
+// empty by default, meaning highlight falls back to an unhighlighted
+// plain-text block instead.
+var PygmentizePath string
+
+func highlightCacheKey(lexer, options, code string) string {
+	sum := sha1.Sum([]byte(lexer + "\x00" + options + "\x00" + code))
+	return hex.EncodeToString(sum[:])
+}
+
+// highlight renders code as syntax-highlighted HTML. options is a
+// comma-separated list of flags; currently only "classes" is recognized,
+// switching from inline-styled output (the default) to output that expects
+// the stylesheet from highlightCSS to be present on the page.
+func highlight(code, lexerName, options string) template.HTML {
+	key := highlightCacheKey(lexerName, options, code)
+	if cached, ok := highlightCache.Load(key); ok {
+		return cached.(template.HTML)
+	}
+
+	result := template.HTML(renderHighlighted(code, lexerName, options))
+
+	if _, loaded := highlightCache.LoadOrStore(key, result); !loaded {
+		if atomic.AddInt64(&highlightCacheSize, 1) > highlightCacheLimit {
+			resetHighlightCache()
+		}
+	}
+
+	return result
+}
+
+// resetHighlightCache drops every entry in highlightCache, used once it hits
+// highlightCacheLimit.
+func resetHighlightCache() {
+	highlightCache.Range(func(k, _ interface{}) bool {
+		highlightCache.Delete(k)
+		return true
+	})
+	atomic.StoreInt64(&highlightCacheSize, 0)
+}
+
+func renderHighlighted(code, lexerName, options string) string {
+	lexer := lexers.Get(lexerName)
+	if lexer == nil {
+		if out, perr := highlightViaPygments(code, lexerName); perr == nil {
+			return out
+		}
+		lexer = lexers.Fallback
+	}
+	lexer = chroma.Coalesce(lexer)
+
+	style := styles.Get("github")
+	if style == nil {
+		style = styles.Fallback
+	}
+
+	formatter := chromahtml.New(chromahtml.WithClasses(strings.Contains(options, "classes")))
+
+	iterator, err := lexer.Tokenise(nil, code)
+	var buf bytes.Buffer
+	if err == nil {
+		err = formatter.Format(&buf, style, iterator)
+	}
+
+	if err == nil {
+		return buf.String()
+	}
+
+	if out, perr := highlightViaPygments(code, lexerName); perr == nil {
+		return out
+	}
+
+	Log.Warningdf(JLData{"error": err.Error(), "lexer": lexerName}, "highlight: falling back to plain text")
+	return template.HTMLEscapeString(code)
+}
+
+// highlightViaPygments shells out to pygmentize for languages Chroma
+// doesn't recognize or fails to render. Only used when PygmentizePath is
+// configured.
+func highlightViaPygments(code, lexerName string) (string, error) {
+	if PygmentizePath == "" {
+		return "", fmt.Errorf("pygmentize fallback not configured")
+	}
+
+	cmd := exec.Command(PygmentizePath, "-l", lexerName, "-f", "html", "-O", "nowrap=True")
+	cmd.Stdin = strings.NewReader(code)
+
+	var out bytes.Buffer
+	cmd.Stdout = &out
+
+	if err := cmd.Run(); err != nil {
+		return "", err
+	}
+
+	return out.String(), nil
+}
+
+// highlightCSS returns the stylesheet highlight needs when called with the
+// "classes" option, for the given Chroma style name (e.g. "github",
+// "monokai"). Render it once per page, typically in the document <head>.
+func highlightCSS(style string) template.CSS {
+	s := styles.Get(style)
+	if s == nil {
+		s = styles.Fallback
+	}
+
+	var buf bytes.Buffer
+	chromahtml.New(chromahtml.WithClasses(true)).WriteCSS(&buf, s)
+
+	return template.CSS(buf.String())
+}
@@ -0,0 +1,292 @@
+package jantar
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"sync"
+
+	"github.com/BurntSushi/toml"
+	"github.com/howeyc/fsnotify"
+	yaml "gopkg.in/yaml.v2"
+)
+
+// localeCatalog holds one locale's translations, keyed by message key. A
+// value is either a plain string, or a map with "one"/"other" forms for
+// keys used through Plural.
+type localeCatalog map[string]interface{}
+
+// I18n loads translation catalogs from a directory (one file per locale,
+// named "<locale>.toml"/".yaml"/".json") and resolves them per request. It
+// watches the directory the same way TemplateManager watches templates.
+type I18n struct {
+	directory     string
+	DefaultLocale string
+
+	// DevMode surfaces missing translation keys through the logger instead
+	// of silently falling back.
+	DevMode bool
+
+	watcher *fsnotify.Watcher
+
+	mu       sync.RWMutex
+	catalogs map[string]localeCatalog
+}
+
+// NewI18n creates an I18n loading catalogs from directory, falling back to
+// defaultLocale when a key or locale is missing.
+func NewI18n(directory, defaultLocale string) *I18n {
+	return &I18n{
+		directory:     strings.Replace(strings.ToLower(directory), "\\", "/", -1),
+		DefaultLocale: defaultLocale,
+	}
+}
+
+// Load (re)reads every catalog file in the configured directory.
+func (i *I18n) Load() error {
+	entries, err := ioutil.ReadDir(i.directory)
+	if err != nil {
+		return err
+	}
+
+	catalogs := make(map[string]localeCatalog)
+
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+
+		ext := filepath.Ext(entry.Name())
+		locale := strings.ToLower(strings.TrimSuffix(entry.Name(), ext))
+
+		data, err := ioutil.ReadFile(filepath.Join(i.directory, entry.Name()))
+		if err != nil {
+			return err
+		}
+
+		catalog := make(localeCatalog)
+
+		switch strings.ToLower(ext) {
+		case ".json":
+			err = json.Unmarshal(data, &catalog)
+		case ".yaml", ".yml":
+			err = yaml.Unmarshal(data, &catalog)
+		case ".toml":
+			err = toml.Unmarshal(data, &catalog)
+		default:
+			continue
+		}
+
+		if err != nil {
+			return fmt.Errorf("i18n: failed to load catalog '%s': %s", entry.Name(), err.Error())
+		}
+
+		catalogs[locale] = catalog
+	}
+
+	i.mu.Lock()
+	i.catalogs = catalogs
+	i.mu.Unlock()
+
+	return nil
+}
+
+// Watch starts watching the catalog directory for changes, reloading on
+// every event other than a rename. Mirrors TemplateManager.watch.
+func (i *I18n) Watch() error {
+	var err error
+
+	if i.watcher, err = fsnotify.NewWatcher(); err != nil {
+		return err
+	}
+
+	if err = i.watcher.Watch(i.directory); err != nil {
+		return err
+	}
+
+	go i.watch()
+	return nil
+}
+
+func (i *I18n) watch() {
+	for {
+		select {
+		case ev := <-i.watcher.Event:
+			if !ev.IsRename() {
+				Log.Debug("reloading i18n catalogs")
+				go i.Load()
+			}
+		case err := <-i.watcher.Error:
+			Log.Warningdf(JLData{"error": err}, "i18n file watcher error")
+			return
+		}
+	}
+}
+
+// asStringMap normalizes the two shapes a nested map can come back as after
+// decoding: map[string]interface{} (json, toml) and map[interface{}]interface{}
+// (yaml.v2).
+func asStringMap(v interface{}) (map[string]interface{}, bool) {
+	switch m := v.(type) {
+	case map[string]interface{}:
+		return m, true
+	case map[interface{}]interface{}:
+		out := make(map[string]interface{}, len(m))
+		for k, val := range m {
+			if ks, ok := k.(string); ok {
+				out[ks] = val
+			}
+		}
+		return out, true
+	}
+	return nil, false
+}
+
+func (i *I18n) hasLocale(locale string) bool {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+	_, ok := i.catalogs[locale]
+	return ok
+}
+
+func (i *I18n) lookup(locale, key string) (string, bool) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	catalog, ok := i.catalogs[locale]
+	if !ok {
+		return "", false
+	}
+
+	if msg, ok := catalog[key].(string); ok {
+		return msg, true
+	}
+
+	return "", false
+}
+
+func (i *I18n) lookupPlural(locale, key, form string) (string, bool) {
+	i.mu.RLock()
+	defer i.mu.RUnlock()
+
+	catalog, ok := i.catalogs[locale]
+	if !ok {
+		return "", false
+	}
+
+	forms, ok := asStringMap(catalog[key])
+	if !ok {
+		return "", false
+	}
+
+	if msg, ok := forms[form].(string); ok {
+		return msg, true
+	}
+	if msg, ok := forms["other"].(string); ok {
+		return msg, true
+	}
+
+	return "", false
+}
+
+func (i *I18n) missing(locale, key string) string {
+	if i.DevMode {
+		Log.Warningdf(JLData{"locale": locale, "key": key}, "i18n: missing translation key")
+	}
+	return key
+}
+
+// T returns the translation for key in locale, formatted with args via
+// fmt.Sprintf-style verbs. Falls back to DefaultLocale, then to key itself.
+func (i *I18n) T(locale, key string, args ...interface{}) string {
+	msg, ok := i.lookup(locale, key)
+	if !ok {
+		msg, ok = i.lookup(i.DefaultLocale, key)
+	}
+	if !ok {
+		return i.missing(locale, key)
+	}
+
+	if len(args) == 0 {
+		return msg
+	}
+	return fmt.Sprintf(msg, args...)
+}
+
+// Plural returns the form of key matching n ("one" for n == 1, "other"
+// otherwise), falling back the same way T does. Catalog entries for
+// pluralized keys are maps with "one"/"other" forms rather than a plain
+// string.
+func (i *I18n) Plural(locale, key string, n int, args ...interface{}) string {
+	form := "other"
+	if n == 1 {
+		form = "one"
+	}
+
+	msg, ok := i.lookupPlural(locale, key, form)
+	if !ok {
+		msg, ok = i.lookupPlural(i.DefaultLocale, key, form)
+	}
+	if !ok {
+		return i.missing(locale, key)
+	}
+
+	return fmt.Sprintf(msg, append([]interface{}{n}, args...)...)
+}
+
+// ResolveLocale determines the locale for req: a URL path prefix
+// ("/de/..."), then a "locale" cookie, then the Accept-Language header,
+// falling back to DefaultLocale. Each candidate is only used if a catalog
+// was actually loaded for it.
+func (i *I18n) ResolveLocale(req *http.Request) string {
+	if parts := strings.SplitN(strings.TrimPrefix(req.URL.Path, "/"), "/", 2); len(parts) > 0 {
+		if i.hasLocale(strings.ToLower(parts[0])) {
+			return strings.ToLower(parts[0])
+		}
+	}
+
+	if cookie, err := req.Cookie("locale"); err == nil {
+		if locale := strings.ToLower(cookie.Value); i.hasLocale(locale) {
+			return locale
+		}
+	}
+
+	for _, tag := range strings.Split(req.Header.Get("Accept-Language"), ",") {
+		locale := strings.ToLower(strings.TrimSpace(strings.SplitN(tag, ";", 2)[0]))
+		if i.hasLocale(locale) {
+			return locale
+		}
+	}
+
+	return i.DefaultLocale
+}
+
+// TmplFuncsForLocale returns the per-invocation overrides that bind T and
+// plural to locale. Pass the result as RenderTemplate's overrides argument
+// so the catalog used inside the template matches the resolved locale,
+// without mutating any shared state.
+func (i *I18n) TmplFuncsForLocale(locale string) map[string]interface{} {
+	return map[string]interface{}{
+		"T": func(key string, args ...interface{}) string {
+			return i.T(locale, key, args...)
+		},
+		"plural": func(key string, n int, args ...interface{}) string {
+			return i.Plural(locale, key, n, args...)
+		},
+	}
+}
+
+// Register installs placeholder T/plural template funcs on tm so the names
+// exist at parse time, using DefaultLocale. Pass TmplFuncsForLocale(locale)
+// as RenderTemplate overrides to resolve them per request instead.
+func (i *I18n) Register(tm *TemplateManager) {
+	tm.AddTmplFunc("T", func(key string, args ...interface{}) string {
+		return i.T(i.DefaultLocale, key, args...)
+	})
+	tm.AddTmplFunc("plural", func(key string, n int, args ...interface{}) string {
+		return i.Plural(i.DefaultLocale, key, n, args...)
+	})
+}
@@ -0,0 +1,127 @@
+package jantar
+
+import (
+	"fmt"
+	"net/http"
+	"sync"
+	"time"
+)
+
+// liveReloadDebounce coalesces reload events within this window into a
+// single broadcast, so editors that write several files in a burst (saves,
+// formatters, ...) trigger one browser refresh instead of a storm.
+const liveReloadDebounce = 100 * time.Millisecond
+
+// LiveReload pushes a reload notification to connected browsers whenever the
+// TemplateManager it's attached to finishes a template reload. Its Handler
+// is an ordinary http.Handler, so an app wires it up the same way it
+// registers any other jantar module:
+//
+//	router.Handle("/_livereload", tm.EnableLiveReload("/_livereload"))
+type LiveReload struct {
+	// Path is where the handler is expected to be reachable and is what
+	// the injected <script> connects back to.
+	Path string
+
+	// Origin, if set, is prepended to Path to build an absolute URL for
+	// the EventSource connection. Needed when live-reload is exposed on a
+	// different host/port than the page itself, e.g. behind a reverse
+	// proxy that doesn't forward the dev-only endpoint.
+	Origin string
+
+	mu      sync.Mutex
+	clients map[chan struct{}]bool
+	timer   *time.Timer
+}
+
+// NewLiveReload creates a LiveReload broadcaster listening at path. An
+// empty path defaults to "/_livereload".
+func NewLiveReload(path string) *LiveReload {
+	if path == "" {
+		path = "/_livereload"
+	}
+
+	return &LiveReload{Path: path, clients: make(map[chan struct{}]bool)}
+}
+
+// url returns the address the injected <script> should connect to.
+func (lr *LiveReload) url() string {
+	return lr.Origin + lr.Path
+}
+
+// Notify schedules a reload broadcast, debounced by liveReloadDebounce so a
+// burst of file events collapses into a single browser refresh.
+func (lr *LiveReload) Notify() {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+
+	if lr.timer != nil {
+		lr.timer.Reset(liveReloadDebounce)
+		return
+	}
+
+	lr.timer = time.AfterFunc(liveReloadDebounce, lr.broadcast)
+}
+
+func (lr *LiveReload) broadcast() {
+	lr.mu.Lock()
+	defer lr.mu.Unlock()
+
+	for ch := range lr.clients {
+		select {
+		case ch <- struct{}{}:
+		default:
+		}
+	}
+	lr.timer = nil
+}
+
+// Handler returns the http.Handler that streams reload notifications to the
+// browser as Server-Sent Events. The client reconnects automatically on any
+// connection drop, which is all the injected <script> relies on.
+func (lr *LiveReload) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		flusher, ok := w.(http.Flusher)
+		if !ok {
+			http.Error(w, "streaming unsupported", http.StatusInternalServerError)
+			return
+		}
+
+		w.Header().Set("Content-Type", "text/event-stream")
+		w.Header().Set("Cache-Control", "no-cache")
+		w.Header().Set("Connection", "keep-alive")
+
+		ch := make(chan struct{}, 1)
+
+		lr.mu.Lock()
+		lr.clients[ch] = true
+		lr.mu.Unlock()
+
+		defer func() {
+			lr.mu.Lock()
+			delete(lr.clients, ch)
+			lr.mu.Unlock()
+		}()
+
+		for {
+			select {
+			case <-ch:
+				Log.Debug("pushing live-reload to browser")
+				fmt.Fprint(w, "data: reload\n\n")
+				flusher.Flush()
+			case <-r.Context().Done():
+				return
+			}
+		}
+	})
+}
+
+// EnableLiveReload attaches a LiveReload broadcaster to tm and returns the
+// handler for the app to mount at path (see LiveReload.Path). From then on
+// the "livereload" template function, which newTemplateManager registers,
+// renders the script that connects to it. watch() notifies the broadcaster
+// after every successful loadTemplates.
+func (tm *TemplateManager) EnableLiveReload(path string) http.Handler {
+	tm.liveReload = NewLiveReload(path)
+	return tm.liveReload.Handler()
+}
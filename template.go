@@ -1,6 +1,7 @@
 package jantar
 
 import (
+	"bytes"
 	"fmt"
 	"github.com/howeyc/fsnotify"
 	"html/template"
@@ -11,6 +12,7 @@ import (
 	"path/filepath"
 	"reflect"
 	"strings"
+	"sync"
 	"time"
 )
 
@@ -26,12 +28,131 @@ type TemplateManager struct {
 	hooks
 	directory string
 	watcher   *fsnotify.Watcher
-	tmplFuncs template.FuncMap
-	tmplList  *template.Template
+
+	funcMu     sync.RWMutex
+	tmplFuncs  template.FuncMap
+	proxyFuncs template.FuncMap
+
+	// engine handles ".html" files. extraEngines, keyed by file extension
+	// (".hbs", ...), handles everything registered via RegisterEngine -
+	// this is how a directory can mix, say, Handlebars templates with
+	// html/template ones. Both are swapped out by loadTemplates on every
+	// reload, which runs from the watch() goroutine, so every read and
+	// write goes through engineMu.
+	engineMu     sync.RWMutex
+	engine       TemplateEngine
+	extraEngines map[string]TemplateEngine
+
+	// DevMode enables the browser error overlay: failed parses and renders
+	// are shown as an annotated HTML page instead of a bare error. It
+	// defaults to off so production deployments never leak source snippets.
+	DevMode bool
+
+	devMu  sync.RWMutex
+	devErr *TemplateError
+
+	// liveReload is set by EnableLiveReload. A nil value (the default)
+	// means the "livereload" template func renders nothing.
+	liveReload *LiveReload
+}
+
+// DevError returns the TemplateError captured by the last failed
+// loadTemplates run, or nil if the templates currently loaded cleanly.
+// Only populated while DevMode is enabled.
+func (tm *TemplateManager) DevError() *TemplateError {
+	tm.devMu.RLock()
+	defer tm.devMu.RUnlock()
+	return tm.devErr
+}
+
+func (tm *TemplateManager) setDevError(te *TemplateError) {
+	tm.devMu.Lock()
+	tm.devErr = te
+	tm.devMu.Unlock()
 }
 
-func newTemplateManager(directory string) *TemplateManager {
-	funcs := template.FuncMap{
+// newTemplateManager creates a TemplateManager that parses and renders
+// templates found in directory using engine for ".html" files. A nil engine
+// defaults to html/template via NewHTMLEngine. Use RegisterEngine to have
+// other extensions handled by a different engine.
+func newTemplateManager(directory string, engine TemplateEngine) *TemplateManager {
+	if engine == nil {
+		engine = NewHTMLEngine()
+	}
+
+	tm := &TemplateManager{
+		directory: strings.Replace(strings.ToLower(directory), "\\", "/", -1),
+		engine:    engine,
+	}
+
+	funcs := DefaultTmplFuncs()
+	funcs["livereload"] = func() template.HTML {
+		if tm.liveReload == nil {
+			return template.HTML("")
+		}
+		return template.HTML(fmt.Sprintf(
+			`<script>(function(){var es=new EventSource(%q);es.onmessage=function(){location.reload();};})();</script>`,
+			tm.liveReload.url()))
+	}
+
+	tm.tmplFuncs = funcs
+
+	// register hooks
+	tm.registerHook(TmBeforeParse, reflect.TypeOf(
+		(func(*TemplateManager, string, *[]byte))(nil)))
+	tm.registerHook(TmBeforeRender, reflect.TypeOf(
+		(func(*http.Request, *TemplateManager, string, map[string]interface{}))(nil)))
+
+	return tm
+}
+
+// RegisterEngine associates ext (e.g. ".hbs") with engine, so any template
+// file with that extension is parsed and executed through it instead of the
+// default one passed to newTemplateManager. Must be called before the
+// directory is (re)loaded for it to take effect; templates already loaded
+// are unaffected until the next reload.
+func (tm *TemplateManager) RegisterEngine(ext string, engine TemplateEngine) {
+	tm.engineMu.Lock()
+	defer tm.engineMu.Unlock()
+
+	if tm.extraEngines == nil {
+		tm.extraEngines = make(map[string]TemplateEngine)
+	}
+	tm.extraEngines[strings.ToLower(ext)] = engine
+}
+
+// engineForName returns the TemplateEngine responsible for name, based on
+// its file extension: whatever was registered for that extension via
+// RegisterEngine, falling back to the default engine (used for ".html" and
+// anything else with no extension-specific registration).
+func (tm *TemplateManager) engineForName(name string) TemplateEngine {
+	tm.engineMu.RLock()
+	defer tm.engineMu.RUnlock()
+
+	if e, ok := tm.extraEngines[filepath.Ext(name)]; ok {
+		return e
+	}
+	return tm.engine
+}
+
+// hasExtraEngine reports whether ext has an engine registered for it via
+// RegisterEngine.
+func (tm *TemplateManager) hasExtraEngine(ext string) bool {
+	tm.engineMu.RLock()
+	defer tm.engineMu.RUnlock()
+
+	_, ok := tm.extraEngines[ext]
+	return ok
+}
+
+// DefaultTmplFuncs returns the built-in template helpers every
+// TemplateManager registers. It's exported so tools that parse templates
+// outside of a running TemplateManager - notably tmplgen, which precompiles
+// templates ahead of time - can parse against the same function set.
+func DefaultTmplFuncs() template.FuncMap {
+	return template.FuncMap{
+		"highlight":    highlight,
+		"highlightCSS": highlightCSS,
 		"antiClickjacking": func() template.HTML {
 			return template.HTML("<style id=\"antiClickjack\">body{display:none !important;}</style>")
 		},
@@ -115,16 +236,6 @@ func newTemplateManager(directory string) *TemplateManager {
 			return template.HTML(result + "</ul>")
 		},
 	}
-
-	tm := &TemplateManager{directory: strings.Replace(strings.ToLower(directory), "\\", "/", -1), tmplFuncs: funcs}
-
-	// register hooks
-	tm.registerHook(TmBeforeParse, reflect.TypeOf(
-		(func(*TemplateManager, string, *[]byte))(nil)))
-	tm.registerHook(TmBeforeRender, reflect.TypeOf(
-		(func(*http.Request, *TemplateManager, *template.Template, map[string]interface{}))(nil)))
-
-	return tm
 }
 
 // watch listens for file events and reloads templates on changes
@@ -132,9 +243,14 @@ func (tm *TemplateManager) watch() {
 	for {
 		select {
 		case ev := <-tm.watcher.Event:
-			if !ev.IsRename() && filepath.Ext(ev.Name) == ".html" {
+			ext := filepath.Ext(ev.Name)
+			if !ev.IsRename() && (ext == ".html" || tm.hasExtraEngine(ext)) {
 				Log.Debug("reloading templates")
-				go tm.loadTemplates()
+				go func() {
+					if err := tm.loadTemplates(); err == nil && tm.liveReload != nil {
+						tm.liveReload.Notify()
+					}
+				}()
 				return
 			}
 		case err := <-tm.watcher.Error:
@@ -144,9 +260,54 @@ func (tm *TemplateManager) watch() {
 	}
 }
 
+// resolveFunc returns the implementation currently registered for name.
+// Per-invocation overrides aren't handled here - RenderTemplate hands them
+// to the engine directly for that single call (see Execute).
+func (tm *TemplateManager) resolveFunc(name string) (interface{}, bool) {
+	tm.funcMu.RLock()
+	defer tm.funcMu.RUnlock()
+
+	fn, ok := tm.tmplFuncs[name]
+	return fn, ok
+}
+
+// proxyFuncMap returns the FuncMap handed to the template engine at parse
+// time. Every entry is a stable proxy (see makeProxy) that dispatches
+// through tm.tmplFuncs at execution time rather than binding a function
+// value directly, so AddTmplFunc can replace an implementation without
+// re-parsing. Proxies are cached by name and reused across reloads; a name
+// only gets a proxy the first time it's seen, which is also the earliest a
+// newly-added function becomes usable from a template.
+func (tm *TemplateManager) proxyFuncMap() template.FuncMap {
+	tm.funcMu.Lock()
+	defer tm.funcMu.Unlock()
+
+	if tm.proxyFuncs == nil {
+		tm.proxyFuncs = make(template.FuncMap, len(tm.tmplFuncs))
+	}
+
+	for name, fn := range tm.tmplFuncs {
+		if _, ok := tm.proxyFuncs[name]; !ok {
+			tm.proxyFuncs[name] = makeProxy(name, reflect.TypeOf(fn), tm.resolveFunc)
+		}
+	}
+
+	return tm.proxyFuncs
+}
+
 func (tm *TemplateManager) loadTemplates() error {
 	var err error
-	var templates *template.Template
+
+	// one fresh engine instance per configured extension, including the
+	// default ".html" one, so a reload doesn't mix old and new template
+	// trees
+	tm.engineMu.RLock()
+	engines := map[string]TemplateEngine{".html": tm.engine.New()}
+	for ext, e := range tm.extraEngines {
+		engines[ext] = e.New()
+	}
+	tm.engineMu.RUnlock()
+
 	var staticTemplates *template.Template
 
 	// close watcher if running
@@ -177,98 +338,136 @@ func (tm *TemplateManager) loadTemplates() error {
 			return nil
 		}
 
-		if strings.HasSuffix(info.Name(), ".html") {
-			if strings.HasPrefix(path, tm.directory+"/static/") {
-				static = true
-			}
+		engine, ok := engines[filepath.Ext(info.Name())]
+		if !ok {
+			// not a recognized template extension
+			return nil
+		}
 
-			fdata, err := ioutil.ReadFile(path)
-			if err != nil {
-				Log.Error(err)
-				return err
-			}
+		if strings.HasSuffix(info.Name(), ".html") && strings.HasPrefix(path, tm.directory+"/static/") {
+			static = true
+		}
 
-			tmplName := path[len(tm.directory)+1:]
+		fdata, err := ioutil.ReadFile(path)
+		if err != nil {
+			Log.Error(err)
+			return err
+		}
 
-			// is it a static file?
-			if static {
-				if staticTemplates == nil {
-					staticTemplates, err = template.New(tmplName).Parse(string(fdata))
-				} else {
-					staticTemplates, err = staticTemplates.New(tmplName).Parse(string(fdata))
-				}
+		tmplName := path[len(tm.directory)+1:]
 
-				if err == nil && !strings.HasPrefix(tmplName, "_") && !strings.Contains(tmplName, "/_") {
-					filename := tm.directory + "/_" + tmplName
-					if err = os.MkdirAll(filename[:len(filename)-len(info.Name())-1], os.ModePerm); err == nil {
-						var f *os.File
-						if f, err = os.Create(filename); err == nil {
-							err = staticTemplates.Lookup(tmplName).Execute(f, nil)
-						}
-					}
-				}
+		// is it a static file? static pre-rendering is only meaningful for
+		// the default html/template engine
+		if static {
+			if staticTemplates == nil {
+				staticTemplates, err = template.New(tmplName).Parse(string(fdata))
 			} else {
-				// call BEFORE_PARSE hooks
-				hooks := tm.getHooks(TmBeforeParse)
-				for _, hook := range hooks {
-					hook.(func(*TemplateManager, string, *[]byte))(tm, tmplName, &fdata)
-				}
+				staticTemplates, err = staticTemplates.New(tmplName).Parse(string(fdata))
+			}
 
-				// add the custom template functions to the first template
-				if templates == nil {
-					templates, err = template.New(tmplName).Funcs(tm.tmplFuncs).Parse(string(fdata))
-				} else {
-					_, err = templates.New(tmplName).Parse(string(fdata))
+			if err == nil && !strings.HasPrefix(tmplName, "_") && !strings.Contains(tmplName, "/_") {
+				filename := tm.directory + "/_" + tmplName
+				if err = os.MkdirAll(filename[:len(filename)-len(info.Name())-1], os.ModePerm); err == nil {
+					var f *os.File
+					if f, err = os.Create(filename); err == nil {
+						err = staticTemplates.Lookup(tmplName).Execute(f, nil)
+					}
 				}
 			}
+		} else {
+			// call BEFORE_PARSE hooks
+			hooks := tm.getHooks(TmBeforeParse)
+			for _, hook := range hooks {
+				hook.(func(*TemplateManager, string, *[]byte))(tm, tmplName, &fdata)
+			}
 
-			if err != nil {
-				Log.Error(err)
-				return err
+			err = engine.Parse(tmplName, fdata, tm.proxyFuncMap())
+		}
+
+		if err != nil {
+			Log.Error(err)
+			if tm.DevMode {
+				tm.setDevError(tm.newTemplateError(err, tmplName))
 			}
+			return err
 		}
 		return nil
 	})
 
-	// no errors occured, override the old list
+	// no errors occured, swap in the newly built engines
 	if ret == nil {
-		tm.tmplList = templates
+		tm.engineMu.Lock()
+		tm.engine = engines[".html"]
+		for ext := range tm.extraEngines {
+			tm.extraEngines[ext] = engines[ext]
+		}
+		tm.engineMu.Unlock()
+		tm.setDevError(nil)
 	}
 
 	return ret
 }
 
-func (tm *TemplateManager) getTemplate(name string) *template.Template {
-	if tm.tmplList == nil {
-		return nil
-	}
-
-	return tm.tmplList.Lookup(strings.ToLower(name))
+func (tm *TemplateManager) getTemplate(name string) bool {
+	return tm.engineForName(name).Lookup(strings.ToLower(name))
 }
 
-// AddTmplFunc adds a template function with a given name and function pointer.
-// Note: AddTmplFunc has no effect if called after the templates have been parsed.
+// AddTmplFunc adds or replaces a template function under name. Because
+// parsed templates call through a proxy that resolves the implementation at
+// execution time (see proxyFuncMap), replacing an existing function takes
+// effect immediately, even for templates parsed before this call. Adding a
+// function under a brand new name only becomes usable from templates parsed
+// after this call, since the engine still needs to see the name at parse
+// time.
 func (tm *TemplateManager) AddTmplFunc(name string, fn interface{}) {
+	tm.funcMu.Lock()
 	tm.tmplFuncs[name] = fn
+	tm.funcMu.Unlock()
 }
 
-// RenderTemplate renders a template with the given name and arguments.
+// RenderTemplate renders a template with the given name and arguments. An
+// optional overrides map may be passed to layer request-scoped functions
+// (the current user, a CSRF token, the resolved locale, ...) on top of the
+// global tmplFuncs for this single call only; only the first overrides
+// argument is used.
 // Note: A Controller should call its Render function instead.
-func (tm *TemplateManager) RenderTemplate(w io.Writer, req *http.Request, name string, args map[string]interface{}) error {
-	tmpl := tm.getTemplate(name)
-	if tmpl == nil {
-		return fmt.Errorf("can't find template '%s'", strings.ToLower(name))
+func (tm *TemplateManager) RenderTemplate(w io.Writer, req *http.Request, name string, args map[string]interface{}, overrides ...map[string]interface{}) error {
+	name = strings.ToLower(name)
+	if !tm.getTemplate(name) {
+		if tm.DevMode {
+			if te := tm.DevError(); te != nil {
+				writeOverlay(w, te)
+			}
+		}
+		return fmt.Errorf("can't find template '%s'", name)
 	}
 
 	// call BEFORE_RENDER hooks
 	hooks := tm.getHooks(TmBeforeRender)
 	for _, hook := range hooks {
-		hook.(func(*http.Request, *TemplateManager, *template.Template, map[string]interface{}))(req, tm, tmpl, args)
+		hook.(func(*http.Request, *TemplateManager, string, map[string]interface{}))(req, tm, name, args)
 	}
 
-	if err := tmpl.Execute(w, args); err != nil {
+	var callFuncs map[string]interface{}
+	if len(overrides) > 0 {
+		callFuncs = overrides[0]
+	}
+
+	// Render into a buffer instead of w directly: a failure partway through
+	// Execute would otherwise leave w holding a truncated document, with
+	// either a bare error or (in DevMode) the overlay appended after it
+	// rather than replacing it.
+	var buf bytes.Buffer
+	if err := tm.engineForName(name).Execute(&buf, name, args, callFuncs); err != nil {
+		if tm.DevMode {
+			if te := tm.newTemplateError(err, name); te != nil {
+				writeOverlay(w, te)
+				return fmt.Errorf("failed to render template. Reason: %s", err.Error())
+			}
+		}
 		return fmt.Errorf("failed to render template. Reason: %s", err.Error())
 	}
 
-	return nil
+	_, err := buf.WriteTo(w)
+	return err
 }
@@ -0,0 +1,256 @@
+package jantar
+
+import (
+	"fmt"
+	"html/template"
+	"io"
+	"sync"
+	textTemplate "text/template"
+
+	"github.com/aymerick/raymond"
+)
+
+// TemplateEngine abstracts the backend used to parse and execute templates,
+// so a TemplateManager isn't hard-wired to html/template. A TemplateManager
+// can mix several engines in one directory - one per file extension, via
+// RegisterEngine - so e.g. Handlebars and html/template templates can
+// coexist. Implementations are expected to behave like a prototype: New
+// returns a fresh, empty instance of the same backend, which loadTemplates
+// uses to build a new template tree on every reload.
+type TemplateEngine interface {
+	// Parse compiles the named template from src. funcs holds the helpers
+	// that should be callable from within the template.
+	Parse(name string, src []byte, funcs map[string]interface{}) error
+
+	// Execute renders the named template with data to w. overrides, when
+	// non-empty, layers additional functions on top of those registered at
+	// Parse time for this single call only - implementations must not let
+	// overrides leak into any other, possibly concurrent, call.
+	Execute(w io.Writer, name string, data interface{}, overrides map[string]interface{}) error
+
+	// Lookup reports whether a template with the given name has been parsed.
+	Lookup(name string) bool
+
+	// New returns a fresh, empty instance of the same backend.
+	New() TemplateEngine
+}
+
+// htmlEngine is the default TemplateEngine, backed by html/template. It
+// auto-escapes output and is what newTemplateManager uses when no engine is
+// given.
+type htmlEngine struct {
+	root *template.Template
+
+	// pristine is a clone of root taken before root's first execution, kept
+	// around solely so Execute can clone from it for calls that need
+	// per-call overrides: html/template refuses to Clone a tree that has
+	// already executed, but root itself is executed directly on every
+	// override-less call.
+	pristineOnce sync.Once
+	pristine     *template.Template
+}
+
+// NewHTMLEngine returns a TemplateEngine backed by html/template.
+func NewHTMLEngine() TemplateEngine {
+	return &htmlEngine{}
+}
+
+func (e *htmlEngine) Parse(name string, src []byte, funcs map[string]interface{}) error {
+	var err error
+
+	if e.root == nil {
+		e.root, err = template.New(name).Funcs(funcs).Parse(string(src))
+	} else {
+		_, err = e.root.New(name).Parse(string(src))
+	}
+
+	return err
+}
+
+func (e *htmlEngine) Execute(w io.Writer, name string, data interface{}, overrides map[string]interface{}) error {
+	e.pristineOnce.Do(func() {
+		if clone, err := e.root.Clone(); err == nil {
+			e.pristine = clone
+		}
+	})
+
+	if len(overrides) == 0 {
+		tmpl := e.root.Lookup(name)
+		if tmpl == nil {
+			return fmt.Errorf("can't find template '%s'", name)
+		}
+		return tmpl.Execute(w, data)
+	}
+
+	if e.pristine == nil {
+		return fmt.Errorf("can't apply per-call overrides to template '%s'", name)
+	}
+
+	clone, err := e.pristine.Clone()
+	if err != nil {
+		return err
+	}
+
+	tmpl := clone.Lookup(name)
+	if tmpl == nil {
+		return fmt.Errorf("can't find template '%s'", name)
+	}
+
+	return tmpl.Funcs(overrides).Execute(w, data)
+}
+
+func (e *htmlEngine) Lookup(name string) bool {
+	return e.root != nil && e.root.Lookup(name) != nil
+}
+
+func (e *htmlEngine) New() TemplateEngine {
+	return &htmlEngine{}
+}
+
+// wrapHTMLEngine returns a TemplateEngine serving an already-parsed
+// template tree, used by LoadCompiledTemplates to skip Parse entirely.
+func wrapHTMLEngine(root *template.Template) TemplateEngine {
+	return &htmlEngine{root: root}
+}
+
+// textEngine is a TemplateEngine backed by text/template, for output that
+// shouldn't be HTML-escaped (emails, config files, plain-text reports, ...).
+type textEngine struct {
+	root *textTemplate.Template
+}
+
+// NewTextEngine returns a TemplateEngine backed by text/template.
+func NewTextEngine() TemplateEngine {
+	return &textEngine{}
+}
+
+func (e *textEngine) Parse(name string, src []byte, funcs map[string]interface{}) error {
+	var err error
+
+	if e.root == nil {
+		e.root, err = textTemplate.New(name).Funcs(funcs).Parse(string(src))
+	} else {
+		_, err = e.root.New(name).Parse(string(src))
+	}
+
+	return err
+}
+
+func (e *textEngine) Execute(w io.Writer, name string, data interface{}, overrides map[string]interface{}) error {
+	tmpl := e.root.Lookup(name)
+	if tmpl == nil {
+		return fmt.Errorf("can't find template '%s'", name)
+	}
+
+	if len(overrides) == 0 {
+		return tmpl.Execute(w, data)
+	}
+
+	// Unlike html/template, text/template.Clone has no restriction against
+	// cloning an already-executed tree, so there's no need for a pristine
+	// snapshot - clone on demand, straight from root.
+	clone, err := tmpl.Clone()
+	if err != nil {
+		return err
+	}
+
+	return clone.Funcs(overrides).Execute(w, data)
+}
+
+func (e *textEngine) Lookup(name string) bool {
+	return e.root != nil && e.root.Lookup(name) != nil
+}
+
+func (e *textEngine) New() TemplateEngine {
+	return &textEngine{}
+}
+
+// handlebarsTemplate pairs a parsed raymond template with the source it was
+// parsed from, so Execute can re-parse a fresh, unshared instance whenever a
+// call needs per-call overrides (raymond.Template.RegisterHelper panics on a
+// name that's already registered, so the shared instance's helpers can't
+// simply be replaced for one call).
+type handlebarsTemplate struct {
+	src  string
+	tmpl *raymond.Template
+}
+
+// handlebarsEngine is a TemplateEngine backed by raymond, a Go
+// implementation of Handlebars. Unlike the text/template family it has no
+// concept of a shared root template, so each parsed template is kept in a
+// map of its own.
+type handlebarsEngine struct {
+	templates map[string]*handlebarsTemplate
+	helpers   map[string]interface{}
+}
+
+// NewHandlebarsEngine returns a TemplateEngine backed by raymond
+// (Handlebars for Go).
+func NewHandlebarsEngine() TemplateEngine {
+	return &handlebarsEngine{templates: make(map[string]*handlebarsTemplate)}
+}
+
+func (e *handlebarsEngine) Parse(name string, src []byte, funcs map[string]interface{}) error {
+	tmpl, err := raymond.Parse(string(src))
+	if err != nil {
+		return err
+	}
+
+	if len(funcs) > 0 {
+		tmpl.RegisterHelpers(funcs)
+	}
+	e.helpers = funcs
+
+	if e.templates == nil {
+		e.templates = make(map[string]*handlebarsTemplate)
+	}
+	e.templates[name] = &handlebarsTemplate{src: string(src), tmpl: tmpl}
+
+	return nil
+}
+
+func (e *handlebarsEngine) Execute(w io.Writer, name string, data interface{}, overrides map[string]interface{}) error {
+	entry, ok := e.templates[name]
+	if !ok {
+		return fmt.Errorf("can't find template '%s'", name)
+	}
+
+	tmpl := entry.tmpl
+	if len(overrides) > 0 {
+		// raymond has no notion of a per-execution FuncMap, and its
+		// RegisterHelper panics on a name that's already bound, so the
+		// shared tmpl can't be reused here: re-parse a disposable instance
+		// and register the merged helpers on that instead.
+		fresh, err := raymond.Parse(entry.src)
+		if err != nil {
+			return err
+		}
+
+		merged := make(map[string]interface{}, len(e.helpers)+len(overrides))
+		for k, v := range e.helpers {
+			merged[k] = v
+		}
+		for k, v := range overrides {
+			merged[k] = v
+		}
+		fresh.RegisterHelpers(merged)
+		tmpl = fresh
+	}
+
+	out, err := tmpl.Exec(data)
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, out)
+	return err
+}
+
+func (e *handlebarsEngine) Lookup(name string) bool {
+	_, ok := e.templates[name]
+	return ok
+}
+
+func (e *handlebarsEngine) New() TemplateEngine {
+	return &handlebarsEngine{templates: make(map[string]*handlebarsTemplate)}
+}
@@ -0,0 +1,151 @@
+package jantar
+
+import (
+	"bytes"
+	"fmt"
+	"html"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// snippetRadius is the number of lines of context shown above and below the
+// offending line in a TemplateError overlay.
+const snippetRadius = 5
+
+// templateErrorPattern matches the error format used by both text/template
+// and html/template: "template: name:line: msg" or "template: name:line:col: msg".
+var templateErrorPattern = regexp.MustCompile(`^template: ([^:]+):(\d+)(?::(\d+))?: (.+)$`)
+
+// raymondErrorPattern matches the error format raymond (the Handlebars
+// engine) uses for parse errors: "Parse error on line N:\nmsg". Unlike
+// templateErrorPattern it carries no template name, since raymond has no
+// notion of one - newTemplateError falls back to the name it was given.
+var raymondErrorPattern = regexp.MustCompile(`(?s)^Parse error on line (\d+):\n(.+)$`)
+
+// TemplateError describes a template parse or execution failure together
+// with enough source context to render a browser-friendly overlay. It is
+// only produced when TemplateManager.DevMode is enabled.
+type TemplateError struct {
+	File    string
+	Line    int
+	Column  int
+	Message string
+	Snippet []SnippetLine
+}
+
+// SnippetLine is one line of source context shown in a TemplateError
+// overlay.
+type SnippetLine struct {
+	Number int
+	Text   string
+	Bad    bool // true for the line the error was reported on
+}
+
+// newTemplateError turns a template engine error into a TemplateError,
+// re-reading the offending file to extract ±snippetRadius lines of source
+// context. fallbackName is used as the file when the error format itself
+// carries no template name (raymond's doesn't). It returns nil if err
+// doesn't match a recognized format.
+func (tm *TemplateManager) newTemplateError(err error, fallbackName string) *TemplateError {
+	if err == nil {
+		return nil
+	}
+
+	var te *TemplateError
+	if m := templateErrorPattern.FindStringSubmatch(err.Error()); m != nil {
+		line, _ := strconv.Atoi(m[2])
+		column, _ := strconv.Atoi(m[3])
+		te = &TemplateError{File: m[1], Line: line, Column: column, Message: m[4]}
+	} else if m := raymondErrorPattern.FindStringSubmatch(err.Error()); m != nil {
+		line, _ := strconv.Atoi(m[1])
+		te = &TemplateError{File: fallbackName, Line: line, Message: m[2]}
+	} else {
+		return nil
+	}
+	line := te.Line
+
+	data, rerr := ioutil.ReadFile(tm.directory + "/" + te.File)
+	if rerr != nil {
+		return te
+	}
+
+	lines := strings.Split(string(data), "\n")
+
+	from := line - 1 - snippetRadius
+	if from < 0 {
+		from = 0
+	}
+	to := line - 1 + snippetRadius
+	if to > len(lines)-1 {
+		to = len(lines) - 1
+	}
+
+	for i := from; i <= to; i++ {
+		te.Snippet = append(te.Snippet, SnippetLine{Number: i + 1, Text: lines[i], Bad: i == line-1})
+	}
+
+	return te
+}
+
+const overlayCSS = `
+body { margin: 0; background: #1e1e1e; color: #ddd; font-family: -apple-system, sans-serif; }
+.jantar-error { max-width: 900px; margin: 40px auto; padding: 0 20px; }
+.jantar-error h1 { color: #f55; font-size: 20px; }
+.jantar-error .location { font-family: monospace; color: #9cdcfe; }
+.jantar-error .message { font-size: 15px; margin-bottom: 20px; }
+.jantar-error pre.snippet { background: #252526; padding: 12px; overflow-x: auto; border-radius: 4px; line-height: 1.5; }
+.jantar-error pre.snippet .line { display: block; white-space: pre; }
+.jantar-error pre.snippet .line.bad { background: #5a1d1d; color: #fff; }
+`
+
+// Render writes a self-contained HTML overlay page describing te to w.
+func (te *TemplateError) Render(w io.Writer) {
+	var buf bytes.Buffer
+
+	buf.WriteString("<!DOCTYPE html><html><head><meta charset=\"utf-8\"><title>Template Error</title><style>")
+	buf.WriteString(overlayCSS)
+	buf.WriteString("</style></head><body><div class=\"jantar-error\"><h1>Template Error</h1>")
+
+	fmt.Fprintf(&buf, "<p class=\"location\">%s:%d", html.EscapeString(te.File), te.Line)
+	if te.Column > 0 {
+		fmt.Fprintf(&buf, ":%d", te.Column)
+	}
+	buf.WriteString("</p>")
+
+	fmt.Fprintf(&buf, "<p class=\"message\">%s</p>", html.EscapeString(te.Message))
+
+	if len(te.Snippet) > 0 {
+		lexer := strings.TrimPrefix(filepath.Ext(te.File), ".")
+		buf.WriteString("<pre class=\"snippet\">")
+		for _, line := range te.Snippet {
+			class := "line"
+			marker := "   "
+			if line.Bad {
+				class = "line bad"
+				marker = ">> "
+			}
+			fmt.Fprintf(&buf, "<span class=\"%s\">%s%4d| %s</span>\n",
+				class, marker, line.Number, highlight(line.Text, lexer, ""))
+		}
+		buf.WriteString("</pre>")
+	}
+
+	buf.WriteString("</div></body></html>")
+	w.Write(buf.Bytes())
+}
+
+// writeOverlay serves te as an HTML page. If w is an http.ResponseWriter the
+// response is sent with a 500 status, matching how a failed render would
+// otherwise surface as a blank server error.
+func writeOverlay(w io.Writer, te *TemplateError) {
+	if rw, ok := w.(http.ResponseWriter); ok {
+		rw.Header().Set("Content-Type", "text/html; charset=utf-8")
+		rw.WriteHeader(http.StatusInternalServerError)
+	}
+	te.Render(w)
+}
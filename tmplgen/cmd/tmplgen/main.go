@@ -0,0 +1,30 @@
+// Command tmplgen is the prebuilt CLI for github.com/tsurai/jantar/tmplgen.
+// It runs the default (transformer-less) codegen pipeline; projects that
+// need to register Transformers should depend on the tmplgen package
+// directly and call Run themselves instead of invoking this binary.
+//
+// Typical usage, from a //go:generate directive next to the package that
+// should own the generated files:
+//
+//	//go:generate go run github.com/tsurai/jantar/tmplgen/cmd/tmplgen -dir templates -out . -pkg main
+package main
+
+import (
+	"flag"
+	"fmt"
+	"os"
+
+	"github.com/tsurai/jantar/tmplgen"
+)
+
+func main() {
+	dir := flag.String("dir", "templates", "template directory to walk")
+	out := flag.String("out", ".", "directory to write generated tmpl_*.go files to")
+	pkg := flag.String("pkg", "main", "package name for generated files")
+	flag.Parse()
+
+	if err := tmplgen.Run(*dir, *out, *pkg, nil); err != nil {
+		fmt.Fprintln(os.Stderr, "tmplgen:", err)
+		os.Exit(1)
+	}
+}
@@ -0,0 +1,167 @@
+// Package tmplgen walks a template directory the same way TemplateManager
+// does and emits Go source that registers every template at init() time, so
+// a production build can run with the jantar_precompiled build tag and ship
+// as a single binary with no template directory alongside it.
+//
+// It's a library so projects that need to transform template source before
+// it's baked in - the codegen-time counterpart of a TmBeforeParse hook - can
+// depend on this package directly and pass their own Transformers to Run,
+// instead of using the prebuilt cmd/tmplgen binary.
+package tmplgen
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"fmt"
+	"go/format"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// Transformer mirrors the TmBeforeParse hook contract (func(name string, src
+// *[]byte)), so codegen can run the same source transformations a running
+// TemplateManager would apply via AddHook(TmBeforeParse, ...).
+type Transformer func(name string, src *[]byte)
+
+type tmplFile struct {
+	name string // relative path, as TemplateManager would key it
+	src  []byte
+}
+
+// Run walks dir for templates, applies transformers to each in order, and
+// writes the generated tmpl_*.go files plus a tmpl_init.go name list to out,
+// using pkg as their package name.
+func Run(dir, out, pkg string, transformers []Transformer) error {
+	templates, err := collect(dir)
+	if err != nil {
+		return err
+	}
+
+	// stable ordering so regenerating with no real changes produces no diff
+	sort.Slice(templates, func(i, j int) bool { return templates[i].name < templates[j].name })
+
+	if err := os.MkdirAll(out, 0755); err != nil {
+		return err
+	}
+
+	for _, t := range templates {
+		for _, transform := range transformers {
+			transform(t.name, &t.src)
+		}
+
+		if err := writeGenerated(out, pkg, t); err != nil {
+			return fmt.Errorf("%s: %w", t.name, err)
+		}
+	}
+
+	return writeLoader(out, pkg, templates)
+}
+
+// collect walks dir exactly the way TemplateManager.loadTemplates does:
+// recursing into subdirectories, skipping dotfiles and "_static", and
+// keying each template by its path relative to dir.
+func collect(dir string) ([]tmplFile, error) {
+	dir = strings.Replace(strings.ToLower(dir), "\\", "/", -1)
+
+	var templates []tmplFile
+
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+
+		path = strings.Replace(strings.ToLower(path), "\\", "/", -1)
+
+		if info.IsDir() {
+			if strings.HasPrefix(info.Name(), ".") || info.Name() == "_static" {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+
+		if !strings.HasSuffix(info.Name(), ".html") || strings.HasPrefix(path, dir+"/static/") {
+			return nil
+		}
+
+		src, err := ioutil.ReadFile(path)
+		if err != nil {
+			return err
+		}
+
+		templates = append(templates, tmplFile{name: path[len(dir)+1:], src: src})
+		return nil
+	})
+
+	return templates, err
+}
+
+// genFileName derives a Go source filename for name. Sanitizing drops
+// enough information (e.g. "a/b.html" and "a_b.html" both become "a_b_html") that
+// two distinct template names can collide on the same sanitized form; a
+// short hash of the full name is appended so different names never produce
+// the same file, silently overwriting one another's output.
+func genFileName(name string) string {
+	safe := strings.Map(func(r rune) rune {
+		if (r >= 'a' && r <= 'z') || (r >= '0' && r <= '9') {
+			return r
+		}
+		return '_'
+	}, name)
+
+	sum := sha1.Sum([]byte(name))
+	return "tmpl_" + safe + "_" + hex.EncodeToString(sum[:])[:8] + ".go"
+}
+
+func writeGenerated(out, pkg string, t tmplFile) error {
+	src := fmt.Sprintf(`// Code generated by tmplgen. DO NOT EDIT.
+
+//go:build jantar_precompiled
+
+package %s
+
+import "github.com/tsurai/jantar"
+
+func init() {
+	jantar.RegisterCompiledTemplate(%q, %q, jantar.CompiledTmplFuncs())
+}
+`, pkg, t.name, string(t.src))
+
+	formatted, err := format.Source([]byte(src))
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(out, genFileName(t.name)), formatted, 0644)
+}
+
+// writeLoader emits a single tmpl_init.go listing every template name. It is
+// only a listing: nothing checks it against the template directory, so a
+// template removed from disk stays compiled in until tmplgen is run again.
+func writeLoader(out, pkg string, templates []tmplFile) error {
+	var names strings.Builder
+	for _, t := range templates {
+		fmt.Fprintf(&names, "\t%q,\n", t.name)
+	}
+
+	src := fmt.Sprintf(`// Code generated by tmplgen. DO NOT EDIT.
+
+//go:build jantar_precompiled
+
+package %s
+
+// compiledTemplateNames lists every template tmplgen precompiled into this
+// package, sorted by name.
+var compiledTemplateNames = []string{
+%s}
+`, pkg, names.String())
+
+	formatted, err := format.Source([]byte(src))
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(filepath.Join(out, "tmpl_init.go"), formatted, 0644)
+}
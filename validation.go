@@ -1,14 +1,25 @@
-package amber
+package jantar
 
 import (
 	"fmt"
-	"time"
+	"net/mail"
+	"net/url"
 	"reflect"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
 )
 
+// Translator resolves a message key to localized text, matching the shape
+// of the "T" function I18n.TmplFuncsForLocale binds to a locale. It lets
+// `validate:"...,msg=key"` tags go through an i18n catalog.
+type Translator func(key string, args ...interface{}) string
+
 type Validation struct {
 	HasErrors	bool
 	errors 		map[string][]string
+	translate Translator
 }
 
 type ValidationResult struct {
@@ -22,11 +33,15 @@ func (v *Validation) addValidationResult(name string, valid bool, message string
 	result := &ValidationResult{v, valid, name, -1}
 
 		if !valid {
+			if v.errors == nil {
+				v.errors = make(map[string][]string)
+			}
+
 			v.HasErrors = true
 			v.errors[name] = append(v.errors[name], message)
 			result.index = len(v.errors[name]) - 1
 		}
-		
+
 		return result
 }
 
@@ -139,5 +154,228 @@ func (v *Validation) MinMax(name string, obj interface{}, min int, max int) *Val
 		return v.addValidationResult(name, value.Len() >= min && value.Len() <= max, defaultMessage)
 	}
 
+	return nil
+}
+
+func (v *Validation) Email(name string, obj interface{}) *ValidationResult {
+	defaultMessage := "Must be a valid email address"
+
+	value, ok := obj.(string)
+	if !ok {
+		return v.addValidationResult(name, false, defaultMessage)
+	}
+
+	return v.addValidationResult(name, isValidEmail(value), defaultMessage)
+}
+
+// isValidEmail reports whether value is a bare addr-spec with a TLD, not
+// just anything net/mail.ParseAddress accepts: ParseAddress is RFC5322-
+// permissive enough to pass a display-name/angle-addr form like
+// "Foo Bar <a@b.com>" or a TLD-less address like "a@b", neither of which a
+// form's validate:"email" tag author would expect to be "a valid email".
+func isValidEmail(value string) bool {
+	addr, err := mail.ParseAddress(value)
+	if err != nil || addr.Address != value {
+		return false
+	}
+
+	at := strings.LastIndex(value, "@")
+	return at != -1 && strings.Contains(value[at+1:], ".")
+}
+
+func (v *Validation) URL(name string, obj interface{}) *ValidationResult {
+	defaultMessage := "Must be a valid URL"
+
+	value, ok := obj.(string)
+	if !ok {
+		return v.addValidationResult(name, false, defaultMessage)
+	}
+
+	u, err := url.Parse(value)
+	return v.addValidationResult(name, err == nil && u.Scheme != "" && u.Host != "", defaultMessage)
+}
+
+func (v *Validation) Regex(name string, obj interface{}, pattern string) *ValidationResult {
+	defaultMessage := fmt.Sprintf("Must match pattern %s", pattern)
+
+	value, ok := obj.(string)
+	if !ok {
+		return v.addValidationResult(name, false, defaultMessage)
+	}
+
+	matched, err := regexp.MatchString(pattern, value)
+	return v.addValidationResult(name, err == nil && matched, defaultMessage)
+}
+
+func (v *Validation) Match(name string, a interface{}, b interface{}) *ValidationResult {
+	defaultMessage := "Must match"
+	return v.addValidationResult(name, reflect.DeepEqual(a, b), defaultMessage)
+}
+
+func (v *Validation) In(name string, obj interface{}, allowed ...interface{}) *ValidationResult {
+	defaultMessage := "Must be one of the allowed values"
+
+	valid := false
+	for _, a := range allowed {
+		if reflect.DeepEqual(obj, a) {
+			valid = true
+			break
+		}
+	}
+
+	return v.addValidationResult(name, valid, defaultMessage)
+}
+
+func (v *Validation) Length(name string, obj interface{}, exact int) *ValidationResult {
+	defaultMessage := fmt.Sprintf("Must be exactly %d characters long", exact)
+
+	if value, ok := obj.(string); ok {
+		return v.addValidationResult(name, len(value) == exact, defaultMessage)
+	}
+
+	value := reflect.ValueOf(obj)
+	if value.Kind() == reflect.Slice {
+		return v.addValidationResult(name, value.Len() == exact, defaultMessage)
+	}
+
+	return nil
+}
+
+// Errors returns every validation error recorded so far, keyed by field name.
+func (v *Validation) Errors() map[string][]string {
+	return v.errors
+}
+
+// Merge copies other's errors into v, e.g. to combine a nested struct's
+// validation result into its parent's.
+func (v *Validation) Merge(other *Validation) *Validation {
+	if other == nil {
+		return v
+	}
+
+	if v.errors == nil {
+		v.errors = make(map[string][]string)
+	}
+
+	for name, messages := range other.errors {
+		v.errors[name] = append(v.errors[name], messages...)
+	}
+	v.HasErrors = v.HasErrors || other.HasErrors
+
+	return v
+}
+
+// SetTranslator wires `msg=` tag keys in Validate through an i18n catalog
+// (e.g. a closure calling I18n.T for a fixed locale) instead of surfacing
+// the raw key as the message.
+func (v *Validation) SetTranslator(t Translator) *Validation {
+	v.translate = t
+	return v
+}
+
+// TmplFunc returns an "errorsFor" template helper bound to v, for use as a
+// RenderTemplate per-invocation override so a view can call
+// {{errorsFor "Email"}} to render field-level messages.
+func (v *Validation) TmplFunc() map[string]interface{} {
+	return map[string]interface{}{
+		"errorsFor": func(name string) []string {
+			return v.errors[name]
+		},
+	}
+}
+
+// Validate runs struct-tag driven validation over obj (a struct or pointer
+// to one), reading `validate:"..."` tags such as
+// `validate:"required,min=3,max=64,email"`. A `msg=key` entry overrides the
+// default message for every rule on that field; it's resolved through the
+// optional translator (installed with SetTranslator) when one is given,
+// otherwise used as-is.
+func Validate(obj interface{}, translator ...Translator) *Validation {
+	v := &Validation{errors: make(map[string][]string)}
+	if len(translator) > 0 {
+		v.SetTranslator(translator[0])
+	}
+	v.validateStruct(obj)
+	return v
+}
+
+func (v *Validation) validateStruct(obj interface{}) {
+	value := reflect.ValueOf(obj)
+	for value.Kind() == reflect.Ptr {
+		value = value.Elem()
+	}
+
+	if value.Kind() != reflect.Struct {
+		return
+	}
+
+	structType := value.Type()
+	for i := 0; i < structType.NumField(); i++ {
+		field := structType.Field(i)
+
+		tag := field.Tag.Get("validate")
+		if tag == "" {
+			continue
+		}
+
+		v.validateField(field.Name, value.Field(i).Interface(), tag)
+	}
+}
+
+func (v *Validation) validateField(name string, fieldValue interface{}, tag string) {
+	rules := strings.Split(tag, ",")
+
+	msgKey := ""
+	for _, rule := range rules {
+		if strings.HasPrefix(strings.TrimSpace(rule), "msg=") {
+			msgKey = strings.TrimPrefix(strings.TrimSpace(rule), "msg=")
+		}
+	}
+
+	for _, rule := range rules {
+		rule = strings.TrimSpace(rule)
+		if rule == "" || strings.HasPrefix(rule, "msg=") {
+			continue
+		}
+
+		key, arg := rule, ""
+		if idx := strings.Index(rule, "="); idx != -1 {
+			key, arg = rule[:idx], rule[idx+1:]
+		}
+
+		result := v.runTagRule(name, fieldValue, key, arg)
+		if result == nil || result.IsValid() || msgKey == "" {
+			continue
+		}
+
+		if v.translate != nil {
+			result.Message(v.translate(msgKey))
+		} else {
+			result.Message(msgKey)
+		}
+	}
+}
+
+func (v *Validation) runTagRule(name string, fieldValue interface{}, key, arg string) *ValidationResult {
+	switch key {
+	case "required":
+		return v.Required(name, fieldValue)
+	case "email":
+		return v.Email(name, fieldValue)
+	case "url":
+		return v.URL(name, fieldValue)
+	case "min":
+		n, _ := strconv.Atoi(arg)
+		return v.Min(name, fieldValue, n)
+	case "max":
+		n, _ := strconv.Atoi(arg)
+		return v.Max(name, fieldValue, n)
+	case "length":
+		n, _ := strconv.Atoi(arg)
+		return v.Length(name, fieldValue, n)
+	case "regex":
+		return v.Regex(name, fieldValue, arg)
+	}
+
 	return nil
 }
\ No newline at end of file
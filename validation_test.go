@@ -0,0 +1,117 @@
+package jantar
+
+import "testing"
+
+func TestValidationRequired(t *testing.T) {
+	cases := []struct {
+		name  string
+		value interface{}
+		valid bool
+	}{
+		{"nil", nil, false},
+		{"zero int", 0, false},
+		{"nonzero int", 1, true},
+		{"empty string", "", false},
+		{"nonempty string", "x", true},
+	}
+
+	for _, c := range cases {
+		t.Run(c.name, func(t *testing.T) {
+			v := Validate(nil)
+			if got := v.Required("f", c.value).IsValid(); got != c.valid {
+				t.Errorf("Required(%#v) = %v, want %v", c.value, got, c.valid)
+			}
+		})
+	}
+}
+
+func TestValidationEmail(t *testing.T) {
+	cases := []struct {
+		value string
+		valid bool
+	}{
+		{"a@b.com", true},
+		{"a@b", false},               // no TLD
+		{"Foo Bar <a@b.com>", false}, // display-name/angle-addr form
+		{"not-an-email", false},
+	}
+
+	for _, c := range cases {
+		t.Run(c.value, func(t *testing.T) {
+			v := Validate(nil)
+			if got := v.Email("f", c.value).IsValid(); got != c.valid {
+				t.Errorf("Email(%q) = %v, want %v", c.value, got, c.valid)
+			}
+		})
+	}
+}
+
+func TestValidationMessageOverride(t *testing.T) {
+	v := Validate(nil)
+	result := v.Required("f", "")
+	if result.IsValid() {
+		t.Fatal("expected Required(\"\") to be invalid")
+	}
+
+	result.Message("custom message")
+	if got := v.Errors()["f"][0]; got != "custom message" {
+		t.Errorf("Errors()[\"f\"][0] = %q, want %q", got, "custom message")
+	}
+}
+
+func TestValidationMerge(t *testing.T) {
+	a := Validate(nil)
+	a.Required("f1", "")
+
+	b := Validate(nil)
+	b.Required("f2", "")
+
+	a.Merge(b)
+
+	if !a.HasErrors {
+		t.Fatal("expected merged Validation to have errors")
+	}
+	if len(a.Errors()["f2"]) != 1 {
+		t.Errorf("Errors()[\"f2\"] = %v, want 1 entry", a.Errors()["f2"])
+	}
+}
+
+type validateFieldTarget struct {
+	Email string `validate:"required,email,msg=custom_key"`
+	Plain string `validate:"min=3,max=5"`
+	None  string
+}
+
+func TestValidateStructTags(t *testing.T) {
+	obj := validateFieldTarget{Email: "not-an-email", Plain: "ab"}
+	v := Validate(&obj)
+
+	if !v.HasErrors {
+		t.Fatal("expected validation errors")
+	}
+
+	if msgs := v.Errors()["Email"]; len(msgs) != 1 || msgs[0] != "custom_key" {
+		t.Errorf("Errors()[\"Email\"] = %v, want a single \"custom_key\" message", msgs)
+	}
+
+	if msgs := v.Errors()["Plain"]; len(msgs) != 1 {
+		t.Errorf("Errors()[\"Plain\"] = %v, want a single min-length message", msgs)
+	}
+
+	if _, ok := v.Errors()["None"]; ok {
+		t.Error("untagged field should not produce any errors")
+	}
+}
+
+func TestValidateStructTranslatesMessage(t *testing.T) {
+	obj := validateFieldTarget{Email: "not-an-email", Plain: "abc"}
+	v := Validate(nil)
+	v.SetTranslator(func(key string, args ...interface{}) string {
+		return "translated:" + key
+	})
+	v.validateStruct(&obj)
+
+	if msgs := v.Errors()["Email"]; len(msgs) != 1 || msgs[0] != "translated:custom_key" {
+		t.Errorf("Errors()[\"Email\"] = %v, want a single translated message", msgs)
+	}
+}